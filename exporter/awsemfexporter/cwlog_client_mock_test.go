@@ -0,0 +1,46 @@
+// Copyright 2020, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awsemfexporter
+
+import (
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	logGroup      = "test-log-group"
+	logStreamName = "test-log-stream"
+)
+
+// mockCloudWatchLogClient is a testify mock standing in for the CloudWatch Logs SDK
+// client so pusher tests never make real API calls.
+type mockCloudWatchLogClient struct {
+	mock.Mock
+}
+
+func (m *mockCloudWatchLogClient) PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	args := m.Called(input)
+	output, _ := args.Get(0).(*cloudwatchlogs.PutLogEventsOutput)
+	return output, args.Error(1)
+}
+
+// NewAlwaysPassMockLogClient returns a cloudWatchLogClient whose PutLogEvents calls
+// always succeed, invoking run with the call's arguments so the caller can inspect
+// what was submitted.
+func NewAlwaysPassMockLogClient(run func(args mock.Arguments)) *mockCloudWatchLogClient {
+	m := new(mockCloudWatchLogClient)
+	m.On("PutLogEvents", mock.Anything).Run(run).Return(&cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: nil}, nil)
+	return m
+}
@@ -0,0 +1,725 @@
+// Copyright 2020, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awsemfexporter
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/awsemfexporter/spool"
+)
+
+const (
+	// DefaultMaxEventPayloadBytes is the maximum number of bytes CloudWatch Logs
+	// accepts for a single log event, including PerEventHeaderBytes of overhead.
+	DefaultMaxEventPayloadBytes = 256 * 1024 // 256KB
+
+	// PerEventHeaderBytes is the per-event overhead CloudWatch Logs adds on top of
+	// the message bytes when computing an event's size and a batch's total size.
+	PerEventHeaderBytes = 26
+
+	// MaxRequestPayloadBytes is the maximum total size, in bytes, of a single
+	// PutLogEvents request across all the log events it carries.
+	MaxRequestPayloadBytes = 1024 * 1024 // 1MB
+
+	// MaxRequestEventCount is the maximum number of log events a single
+	// PutLogEvents request may carry.
+	MaxRequestEventCount = 10000
+
+	// TruncatedSuffix is appended to a log event's message when it is truncated to
+	// fit within maxEventPayloadBytes.
+	TruncatedSuffix = "[Truncated...]"
+
+	// batchTimeRangeLimit is the maximum difference CloudWatch Logs allows between
+	// the earliest and latest timestamps in a single PutLogEvents batch.
+	batchTimeRangeLimit = 24 * time.Hour
+
+	logEventTimestampLimitPast   = 14 * 24 * time.Hour
+	logEventTimestampLimitFuture = 2 * time.Hour
+)
+
+// maxEventPayloadBytes is a var, rather than a const, so tests can shrink it to
+// exercise truncation without needing megabyte-sized fixtures.
+var maxEventPayloadBytes = DefaultMaxEventPayloadBytes
+
+// cloudWatchLogClient is the subset of the CloudWatch Logs API the pusher depends on.
+// Satisfied by *cloudwatchlogs.CloudWatchLogs; tests supply a mock.
+type cloudWatchLogClient interface {
+	PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// Pusher is the interface the awsemf exporter uses to hand log events to a single
+// CloudWatch Logs stream for batching and delivery.
+type Pusher interface {
+	AddLogEntry(event *LogEvent) error
+	ForceFlush() error
+}
+
+// LogEvent represents a single CloudWatch Logs event queued for delivery.
+type LogEvent struct {
+	InputLogEvent    *cloudwatchlogs.InputLogEvent
+	LogGeneratedTime time.Time
+}
+
+// newLogEvent creates a LogEvent for the given millisecond epoch timestamp and
+// message. A zero timestamp means "derive it from LogGeneratedTime in Validate".
+func newLogEvent(timestampMs int64, message string) *LogEvent {
+	return &LogEvent{
+		InputLogEvent: &cloudwatchlogs.InputLogEvent{
+			Timestamp: aws.Int64(timestampMs),
+			Message:   aws.String(message),
+		},
+	}
+}
+
+// eventPayloadBytes returns the number of bytes this event contributes toward a
+// batch's MaxRequestPayloadBytes limit.
+func (logEvent *LogEvent) eventPayloadBytes() int {
+	return len(*logEvent.InputLogEvent.Message) + PerEventHeaderBytes
+}
+
+// Validate checks the event against CloudWatch Logs' constraints. It truncates an
+// oversized message, stamps in a timestamp derived from LogGeneratedTime when one
+// was not already supplied, and rejects events CloudWatch Logs would reject outright.
+func (logEvent *LogEvent) Validate(logger *zap.Logger) error {
+	if len(*logEvent.InputLogEvent.Message) == 0 {
+		return errors.New("empty log event message")
+	}
+
+	if logEvent.eventPayloadBytes() > maxEventPayloadBytes {
+		truncated := (*logEvent.InputLogEvent.Message)[0 : maxEventPayloadBytes-PerEventHeaderBytes-len(TruncatedSuffix)]
+		truncated += TruncatedSuffix
+		logEvent.InputLogEvent.Message = &truncated
+		logger.Warn("log event exceeds the allowed payload size and will be truncated",
+			zap.Int("max_bytes", maxEventPayloadBytes))
+	}
+
+	if *logEvent.InputLogEvent.Timestamp == 0 {
+		logEvent.InputLogEvent.Timestamp = aws.Int64(logEvent.LogGeneratedTime.UnixNano() / int64(time.Millisecond))
+	}
+
+	eventTime := time.Unix(0, *logEvent.InputLogEvent.Timestamp*int64(time.Millisecond))
+	if time.Since(eventTime) > logEventTimestampLimitPast || time.Until(eventTime) > logEventTimestampLimitFuture {
+		return errors.New("the log entry's timestamp is older than 14 days or more than 2 hours in the future")
+	}
+
+	return nil
+}
+
+// wrappedEvent pairs an InputLogEvent with the order in which it was queued, so that
+// sortEvents can fall back to insertion order whenever two events share a
+// timestamp rather than leaving the tie-break to an unstable sort.
+type wrappedEvent struct {
+	ev          *cloudwatchlogs.InputLogEvent
+	insertOrder int
+}
+
+type byTimestamp []wrappedEvent
+
+func (b byTimestamp) Len() int      { return len(b) }
+func (b byTimestamp) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byTimestamp) Less(i, j int) bool {
+	ti, tj := *b[i].ev.Timestamp, *b[j].ev.Timestamp
+	if ti != tj {
+		return ti < tj
+	}
+	return b[i].insertOrder < b[j].insertOrder
+}
+
+// eventBatch is a self-contained, non-threadsafe accumulator for a single
+// PutLogEvents request. It owns all of the count/byte/timestamp-window accounting
+// that decides whether it can still accept another event, so that accounting can't
+// drift out of sync with the events actually held once it's split out per call site.
+type eventBatch struct {
+	logGroupName  *string
+	logStreamName *string
+
+	events          []*cloudwatchlogs.InputLogEvent
+	insertOrder     map[*cloudwatchlogs.InputLogEvent]int
+	nextInsertOrder int
+
+	byteTotal      int
+	minTimestampMs int64
+	maxTimestampMs int64
+
+	// spoolIDs associates events in this batch with the spool record they were
+	// durably appended as, so the caller can Commit them once the batch has been
+	// sent. Left nil when the pusher's spool is disabled.
+	spoolIDs map[*cloudwatchlogs.InputLogEvent]spool.RecordID
+}
+
+// newEventBatch creates an empty batch for the given log group/stream.
+func newEventBatch(logGroupName, logStreamName *string) *eventBatch {
+	return &eventBatch{
+		logGroupName:  logGroupName,
+		logStreamName: logStreamName,
+		events:        make([]*cloudwatchlogs.InputLogEvent, 0, MaxRequestEventCount),
+		insertOrder:   make(map[*cloudwatchlogs.InputLogEvent]int, MaxRequestEventCount),
+	}
+}
+
+// count returns the number of events currently held by the batch.
+func (b *eventBatch) count() int {
+	return len(b.events)
+}
+
+// bytes returns the aggregate payload size, in bytes, of the events currently held
+// by the batch, as CloudWatch Logs accounts for MaxRequestPayloadBytes.
+func (b *eventBatch) bytes() int {
+	return b.byteTotal
+}
+
+// isFull reports whether the batch already holds MaxRequestEventCount events.
+func (b *eventBatch) isFull() bool {
+	return b.count() >= MaxRequestEventCount
+}
+
+// isActive reports whether an event with the given timestamp could join the batch
+// without pushing its min/max timestamps outside CloudWatch Logs' 24-hour batch
+// window. A batch with no events yet is always active.
+func (b *eventBatch) isActive(timestampMs *int64) bool {
+	if b.minTimestampMs == 0 && b.maxTimestampMs == 0 {
+		return true
+	}
+
+	newMin, newMax := b.minTimestampMs, b.maxTimestampMs
+	if *timestampMs < newMin {
+		newMin = *timestampMs
+	}
+	if *timestampMs > newMax {
+		newMax = *timestampMs
+	}
+	return time.Duration(newMax-newMin)*time.Millisecond <= batchTimeRangeLimit
+}
+
+// add appends ev to the batch, unless doing so would violate CloudWatch Logs' per
+// request event count limit, byte limit, or 24-hour timestamp span, in which case it
+// reports added=false with a reason and leaves the batch untouched; the caller is
+// expected to drain this batch and retry ev against a fresh one.
+func (b *eventBatch) add(ev *LogEvent) (added bool, reason string) {
+	if b.isFull() {
+		return false, "log event batch is full"
+	}
+	if b.byteTotal+ev.eventPayloadBytes() > MaxRequestPayloadBytes {
+		return false, "log event batch would exceed the maximum request payload size"
+	}
+	if !b.isActive(ev.InputLogEvent.Timestamp) {
+		return false, "log event falls outside the batch's 24-hour timestamp window"
+	}
+
+	b.nextInsertOrder++
+	b.insertOrder[ev.InputLogEvent] = b.nextInsertOrder
+	b.events = append(b.events, ev.InputLogEvent)
+	b.byteTotal += ev.eventPayloadBytes()
+
+	ts := *ev.InputLogEvent.Timestamp
+	if b.minTimestampMs == 0 || ts < b.minTimestampMs {
+		b.minTimestampMs = ts
+	}
+	if ts > b.maxTimestampMs {
+		b.maxTimestampMs = ts
+	}
+	return true, ""
+}
+
+// trackSpoolRecord associates a spool record id with an event already added to the
+// batch, so spoolRecordIDs can report it once the batch has been sent.
+func (b *eventBatch) trackSpoolRecord(ev *cloudwatchlogs.InputLogEvent, id spool.RecordID) {
+	if b.spoolIDs == nil {
+		b.spoolIDs = make(map[*cloudwatchlogs.InputLogEvent]spool.RecordID)
+	}
+	b.spoolIDs[ev] = id
+}
+
+// spoolRecordIDs returns the spool record ids associated with this batch's events,
+// for the caller to Commit once delivery succeeds, or nil when spooling isn't in use.
+func (b *eventBatch) spoolRecordIDs() []spool.RecordID {
+	if len(b.spoolIDs) == 0 {
+		return nil
+	}
+	ids := make([]spool.RecordID, 0, len(b.spoolIDs))
+	for _, ev := range b.events {
+		if id, ok := b.spoolIDs[ev]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// drain sorts the batch's events into submission order and returns the
+// PutLogEventsInput ready to send. The batch must not be reused afterward.
+func (b *eventBatch) drain() *cloudwatchlogs.PutLogEventsInput {
+	b.sortEvents()
+	return &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  b.logGroupName,
+		LogStreamName: b.logStreamName,
+		LogEvents:     b.events,
+	}
+}
+
+// sortEvents orders the batch's events by ascending timestamp, breaking ties by
+// insertion order. CloudWatch's PutLogEvents rejects events that are not strictly
+// non-decreasing by timestamp, and real workloads frequently emit several events
+// within the same millisecond, so a plain unstable sort can reorder same-container
+// log lines relative to each other.
+func (b *eventBatch) sortEvents() {
+	wrapped := make([]wrappedEvent, len(b.events))
+	for i, ev := range b.events {
+		wrapped[i] = wrappedEvent{ev: ev, insertOrder: b.insertOrder[ev]}
+	}
+
+	sort.Stable(byTimestamp(wrapped))
+
+	for i, w := range wrapped {
+		b.events[i] = w.ev
+	}
+}
+
+// pusher batches and sends log events for a single CloudWatch Logs stream.
+type pusher struct {
+	logGroupName  *string
+	logStreamName *string
+
+	currentBatch *eventBatch
+
+	sequenceToken *string
+
+	svc    cloudWatchLogClient
+	logger *zap.Logger
+
+	mutex sync.Mutex
+
+	// multilinePattern and multilineTimeout configure optional multiline log
+	// aggregation; multilinePattern is nil when it is disabled.
+	multilinePattern *regexp.Regexp
+	multilineTimeout time.Duration
+
+	pendingMu         sync.Mutex
+	pendingEvent      *LogEvent
+	pendingTimer      *time.Timer
+	pendingGeneration int64
+
+	// spool, when non-nil, durably persists events to disk before they are
+	// considered accepted, so they survive a collector restart.
+	spool *spool.Spool
+
+	// observer, when non-nil, is notified of batch lifecycle events for
+	// observability; nil means no notifications are sent.
+	observer BatchObserver
+}
+
+// PusherOption configures optional pusher behavior at construction time.
+type PusherOption func(*pusher)
+
+// WithMultiline enables multiline log aggregation: an incoming log line starts a new
+// logical event whenever it matches startPattern, and any line that doesn't match is
+// treated as a continuation of the previous line, appended to it with a "\n"
+// separator. A logical event is flushed once the next one starts, or once timeout
+// elapses since its last line, whichever comes first. This mirrors the multiline
+// handling in Docker's awslogs logging driver.
+func WithMultiline(startPattern *regexp.Regexp, timeout time.Duration) PusherOption {
+	return func(p *pusher) {
+		p.multilinePattern = startPattern
+		p.multilineTimeout = timeout
+	}
+}
+
+// BatchObserver is notified of pusher batch lifecycle events, so callers can track
+// batch sizes, send latency, and rejection/truncation rates without having to grep
+// logs for them.
+type BatchObserver interface {
+	// OnBatchReady is called once a batch has accumulated its final set of events
+	// and is about to be drained and sent, whether because it filled up, a new
+	// event no longer fit within its 24-hour timestamp window, or it was
+	// force-flushed.
+	OnBatchReady(size, bytes int, minTimestampMs, maxTimestampMs int64)
+
+	// OnBatchSent is called after a batch's PutLogEvents call returns, whether it
+	// succeeded or failed; err is nil on success.
+	OnBatchSent(size, bytes int, latency time.Duration, err error)
+
+	// OnEventRejected is called whenever a log event does not make it into a batch
+	// unchanged: a validation failure (e.g. "empty log event message", or a
+	// timestamp outside CloudWatch Logs' accepted window), an event dropped
+	// because it can't fit into even a fresh batch, or an event that was only
+	// accepted after being truncated for size ("oversize-truncated").
+	OnEventRejected(reason string)
+}
+
+// WithBatchObserver registers observer to receive pusher batch lifecycle
+// notifications.
+func WithBatchObserver(observer BatchObserver) PusherOption {
+	return func(p *pusher) {
+		p.observer = observer
+	}
+}
+
+// PusherConfig configures the optional on-disk spool that lets a pusher survive
+// collector restarts without losing log events that were accepted but not yet
+// confirmed delivered to CloudWatch Logs.
+type PusherConfig struct {
+	// SpoolDir is the directory spooled events are appended to before being
+	// considered accepted. Spooling is disabled when SpoolDir is empty.
+	SpoolDir string
+	// MaxSpoolBytes bounds the size of a single spool segment file before it is
+	// rotated; <= 0 means unbounded.
+	MaxSpoolBytes int64
+	// Fsync forces every spooled event to be flushed to disk before AddLogEntry
+	// returns, trading throughput for a tighter durability guarantee.
+	Fsync bool
+}
+
+// WithSpool enables the on-disk spool described by cfg and replays any events left
+// behind by a previous run of the process into the pusher's batches. If the spool
+// cannot be opened, spooling is disabled and the error is logged; log delivery
+// otherwise proceeds in memory-only mode, the same as when WithSpool isn't used.
+func WithSpool(cfg PusherConfig) PusherOption {
+	return func(p *pusher) {
+		if cfg.SpoolDir == "" {
+			return
+		}
+
+		sp, err := spool.Open(cfg.SpoolDir, cfg.MaxSpoolBytes, cfg.Fsync)
+		if err != nil {
+			p.logger.Error("failed to open pusher spool, continuing without durability",
+				zap.Error(err), zap.String("spool_dir", cfg.SpoolDir))
+			return
+		}
+		p.spool = sp
+		p.replaySpool()
+	}
+}
+
+// spooledEvent is the on-disk representation of a LogEvent written to the spool.
+type spooledEvent struct {
+	TimestampMs int64  `json:"timestampMs"`
+	Message     string `json:"message"`
+}
+
+func encodeSpoolRecord(event *LogEvent) []byte {
+	payload, _ := json.Marshal(spooledEvent{
+		TimestampMs: *event.InputLogEvent.Timestamp,
+		Message:     *event.InputLogEvent.Message,
+	})
+	return payload
+}
+
+func decodeSpoolRecord(payload []byte) (*LogEvent, error) {
+	var se spooledEvent
+	if err := json.Unmarshal(payload, &se); err != nil {
+		return nil, err
+	}
+	return newLogEvent(se.TimestampMs, se.Message), nil
+}
+
+// replaySpool re-queues events left behind in the spool by a previous run, so they
+// are resent rather than lost. It must run before any new events are accepted.
+func (p *pusher) replaySpool() {
+	records, err := p.spool.Replay()
+	if err != nil {
+		p.logger.Error("failed to replay pusher spool, previously spooled events may be lost", zap.Error(err))
+		return
+	}
+
+	for _, rec := range records {
+		event, err := decodeSpoolRecord(rec.Payload)
+		if err != nil {
+			p.logger.Error("discarding unreadable spooled log event", zap.Error(err))
+			continue
+		}
+
+		id := rec.ID
+		p.mutex.Lock()
+		full := p.addLogEvent(event, &id)
+		p.mutex.Unlock()
+
+		if full != nil {
+			if err := p.pushEventBatch(full); err != nil {
+				p.logger.Error("failed to resend spooled log event batch on startup", zap.Error(err))
+			}
+		}
+	}
+}
+
+// newPusher creates a pusher that sends log events for logStreamName within
+// logGroupName using svc.
+func newPusher(logGroupName, logStreamName *string, svc cloudWatchLogClient, logger *zap.Logger, opts ...PusherOption) *pusher {
+	p := &pusher{
+		logGroupName:  logGroupName,
+		logStreamName: logStreamName,
+		currentBatch:  newEventBatch(logGroupName, logStreamName),
+		svc:           svc,
+		logger:        logger,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// AddLogEntry queues event for delivery, buffering it for multiline aggregation
+// first when WithMultiline was configured.
+func (p *pusher) AddLogEntry(event *LogEvent) error {
+	if event == nil {
+		return nil
+	}
+	if p.multilinePattern != nil {
+		return p.addMultilineLogEntry(event)
+	}
+	return p.validateAndAddLogEntry(event)
+}
+
+// addMultilineLogEntry buffers event, finalizing the previously buffered logical
+// event once event starts a new one (matches multilinePattern) and resetting the
+// timeout that finalizes a dangling buffered event otherwise.
+func (p *pusher) addMultilineLogEntry(event *LogEvent) error {
+	p.pendingMu.Lock()
+
+	if p.pendingEvent != nil && !p.multilinePattern.MatchString(*event.InputLogEvent.Message) {
+		appended := *p.pendingEvent.InputLogEvent.Message + "\n" + *event.InputLogEvent.Message
+		p.pendingEvent.InputLogEvent.Message = &appended
+		p.resetMultilineTimerLocked()
+		p.pendingMu.Unlock()
+		return nil
+	}
+
+	toFinalize := p.pendingEvent
+	p.pendingEvent = event
+	p.resetMultilineTimerLocked()
+	p.pendingMu.Unlock()
+
+	if toFinalize == nil {
+		return nil
+	}
+	return p.validateAndAddLogEntry(toFinalize)
+}
+
+// resetMultilineTimerLocked (re)starts the timer that finalizes a buffered
+// multiline event if no further lines arrive within multilineTimeout. Callers must
+// hold p.pendingMu.
+func (p *pusher) resetMultilineTimerLocked() {
+	if p.pendingTimer != nil {
+		p.pendingTimer.Stop()
+	}
+	p.pendingGeneration++
+	gen := p.pendingGeneration
+	p.pendingTimer = time.AfterFunc(p.multilineTimeout, func() { p.flushPendingMultilineEventIfCurrent(gen) })
+}
+
+// flushPendingMultilineEventIfCurrent finalizes the buffered multiline event only
+// if gen is still the generation in effect when its timer was scheduled. Timer.Stop
+// cannot cancel a callback that has already started running, so a timeout firing at
+// the same instant a continuation line arrives could otherwise race
+// addMultilineLogEntry: it would block on p.pendingMu, then, after the new line was
+// appended and the timer reset, acquire the lock and finalize the buffer mid-growth,
+// splitting one logical event into two. Checking the generation under the lock makes
+// that race a no-op instead.
+func (p *pusher) flushPendingMultilineEventIfCurrent(gen int64) {
+	p.pendingMu.Lock()
+	if gen != p.pendingGeneration {
+		p.pendingMu.Unlock()
+		return
+	}
+	pending := p.pendingEvent
+	p.pendingEvent = nil
+	p.pendingMu.Unlock()
+
+	if pending == nil {
+		return
+	}
+	if err := p.validateAndAddLogEntry(pending); err != nil {
+		p.logger.Error("failed to flush dangling multiline log event", zap.Error(err))
+	}
+}
+
+// flushPendingMultilineEvent unconditionally finalizes any buffered multiline
+// event. Used by ForceFlush/shutdown, which must flush regardless of whether a
+// timeout is also pending.
+func (p *pusher) flushPendingMultilineEvent() {
+	p.pendingMu.Lock()
+	if p.pendingTimer != nil {
+		p.pendingTimer.Stop()
+	}
+	p.pendingGeneration++
+	pending := p.pendingEvent
+	p.pendingEvent = nil
+	p.pendingMu.Unlock()
+
+	if pending == nil {
+		return
+	}
+	if err := p.validateAndAddLogEntry(pending); err != nil {
+		p.logger.Error("failed to flush dangling multiline log event", zap.Error(err))
+	}
+}
+
+// validateAndAddLogEntry validates event, durably spools it if a spool is
+// configured, and queues it for delivery, flushing the current batch first if
+// event can no longer fit into it.
+func (p *pusher) validateAndAddLogEntry(event *LogEvent) error {
+	originalMessage := *event.InputLogEvent.Message
+	if err := event.Validate(p.logger); err != nil {
+		p.logger.Error("rejected log event", zap.Error(err))
+		if p.observer != nil {
+			p.observer.OnEventRejected(err.Error())
+		}
+		return err
+	}
+	if p.observer != nil && *event.InputLogEvent.Message != originalMessage {
+		p.observer.OnEventRejected("oversize-truncated")
+	}
+
+	var spoolID *spool.RecordID
+	if p.spool != nil {
+		id, err := p.spool.Append(encodeSpoolRecord(event))
+		if err != nil {
+			p.logger.Error("failed to spool log event, continuing without durability for this event", zap.Error(err))
+		} else {
+			spoolID = &id
+		}
+	}
+
+	p.mutex.Lock()
+	full := p.addLogEvent(event, spoolID)
+	p.mutex.Unlock()
+
+	if full != nil {
+		return p.pushEventBatch(full)
+	}
+	return nil
+}
+
+// addLogEvent adds event to the pusher's current batch, rolling over to a fresh
+// batch first when the current one can no longer accept it. The caller must hold
+// p.mutex. It returns the former batch once it needs to be sent, or nil when event
+// was simply absorbed by the still-active current batch (or was nil, or invalid).
+// spoolID, when non-nil, is the spool record the event was durably appended as, and
+// is recorded against whichever batch ends up holding the event.
+func (p *pusher) addLogEvent(event *LogEvent, spoolID *spool.RecordID) *eventBatch {
+	if event == nil {
+		return nil
+	}
+
+	if event.InputLogEvent.Message == nil || len(*event.InputLogEvent.Message) == 0 {
+		p.logger.Error("empty log event message")
+		if p.observer != nil {
+			p.observer.OnEventRejected("empty log event message")
+		}
+		p.discardSpoolRecord(spoolID)
+		return nil
+	}
+
+	if added, _ := p.currentBatch.add(event); added {
+		if spoolID != nil {
+			p.currentBatch.trackSpoolRecord(event.InputLogEvent, *spoolID)
+		}
+		return nil
+	}
+
+	full := p.currentBatch
+	if p.observer != nil {
+		p.observer.OnBatchReady(full.count(), full.bytes(), full.minTimestampMs, full.maxTimestampMs)
+	}
+
+	p.currentBatch = newEventBatch(p.logGroupName, p.logStreamName)
+	if added, reason := p.currentBatch.add(event); !added {
+		// A single event can't fit into even a fresh batch on its own; drop it
+		// rather than spin forever, same as we'd do for any other invalid event.
+		p.logger.Error("discarding log event that cannot fit into a fresh batch", zap.String("reason", reason))
+		if p.observer != nil {
+			p.observer.OnEventRejected(reason)
+		}
+		p.discardSpoolRecord(spoolID)
+	} else if spoolID != nil {
+		p.currentBatch.trackSpoolRecord(event.InputLogEvent, *spoolID)
+	}
+	return full
+}
+
+// discardSpoolRecord commits spoolID, if set, without ever sending the event it
+// durably recorded. Used for events dropped during addLogEvent, so they are
+// acknowledged as done rather than replayed forever on every future restart.
+func (p *pusher) discardSpoolRecord(spoolID *spool.RecordID) {
+	if spoolID == nil || p.spool == nil {
+		return
+	}
+	if err := p.spool.Commit(*spoolID); err != nil {
+		p.logger.Error("failed to discard spool record for dropped log event", zap.Error(err))
+	}
+}
+
+// ForceFlush sends any currently buffered log events immediately.
+func (p *pusher) ForceFlush() error {
+	p.flushPendingMultilineEvent()
+
+	p.mutex.Lock()
+	if p.currentBatch.count() == 0 {
+		p.mutex.Unlock()
+		return nil
+	}
+
+	full := p.currentBatch
+	p.currentBatch = newEventBatch(p.logGroupName, p.logStreamName)
+	p.mutex.Unlock()
+
+	if p.observer != nil {
+		p.observer.OnBatchReady(full.count(), full.bytes(), full.minTimestampMs, full.maxTimestampMs)
+	}
+	return p.pushEventBatch(full)
+}
+
+// pushEventBatch sends batch to CloudWatch Logs, threading through the sequence
+// token CloudWatch Logs requires for ordered PutLogEvents calls on the same stream,
+// and commits the batch's spooled events once delivery succeeds.
+func (p *pusher) pushEventBatch(batch *eventBatch) error {
+	input := batch.drain()
+
+	p.mutex.Lock()
+	input.SequenceToken = p.sequenceToken
+	p.mutex.Unlock()
+
+	start := time.Now()
+	output, err := p.svc.PutLogEvents(input)
+	latency := time.Since(start)
+	if p.observer != nil {
+		p.observer.OnBatchSent(batch.count(), batch.bytes(), latency, err)
+	}
+	if err != nil {
+		p.logger.Error("failed to send log events", zap.Error(err), zap.Int("count", len(input.LogEvents)))
+		return err
+	}
+
+	p.mutex.Lock()
+	p.sequenceToken = output.NextSequenceToken
+	p.mutex.Unlock()
+
+	if p.spool != nil {
+		if ids := batch.spoolRecordIDs(); len(ids) > 0 {
+			if err := p.spool.Commit(ids...); err != nil {
+				p.logger.Error("failed to commit spooled log events after successful delivery", zap.Error(err))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,447 @@
+// Copyright 2020, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spool implements a durable, append-only on-disk queue used to survive
+// collector restarts without losing log events that were accepted but not yet
+// confirmed delivered.
+//
+// A Spool is a sequence of rotating segment files under its directory. Each record
+// is length-prefixed and CRC32-checked, so a record left partially written by a
+// crash mid-append is detected on replay and dropped rather than corrupting the
+// records around it. Records are acknowledged individually by RecordID, not merely
+// by count, because a caller may commit them out of order (e.g. a later batch
+// delivered successfully while an earlier one is still outstanding after a failed
+// send); each segment has a small sidecar file recording its contiguous
+// committed-from-zero watermark plus any committed seqs beyond it that are still
+// waiting for the gap below them to close, and Replay skips exactly those records,
+// so neither an acknowledged record nor a never-acknowledged one is ever mishandled
+// across a restart. Once every record appended to a segment has been committed, the
+// segment is sealed: if it was the currently-active one, a fresh segment is rotated
+// in first, and the sealed segment's files (both the WAL and its sidecar) are then
+// removed, bounding on-disk usage to the still-unacknowledged tail.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentPrefix    = "segment-"
+	segmentSuffix    = ".wal"
+	committedSuffix  = ".committed"
+	recordHeaderSize = 8 // 4 bytes payload length + 4 bytes CRC32
+)
+
+// RecordID addresses a single appended record so it can later be acknowledged with
+// Commit.
+type RecordID struct {
+	SegmentID int64
+	Seq       int64
+}
+
+// Record is a payload recovered from the spool during Replay, together with the ID
+// callers must pass to Commit once the payload has been durably handed off
+// downstream.
+type Record struct {
+	ID      RecordID
+	Payload []byte
+}
+
+// segment tracks the bookkeeping Spool needs for one segment file: how many
+// records it holds in total, the contiguous-from-zero prefix that has been
+// committed (watermark), and any committed seqs at or beyond the watermark that
+// arrived out of order and haven't yet been folded into it. Acknowledging by seq
+// rather than by count is what lets Commit handle an out-of-order commit (a later
+// batch succeeding while an earlier one is still outstanding) without mistakenly
+// skipping the still-unacknowledged earlier records on replay.
+type segment struct {
+	id        int64
+	total     int64
+	watermark int64
+	acked     map[int64]struct{}
+}
+
+// Spool is a durable, append-only, CRC-checked on-disk queue of pending payloads.
+// It is safe for concurrent use.
+type Spool struct {
+	dir             string
+	maxSegmentBytes int64
+	fsync           bool
+
+	mu         sync.Mutex
+	segments   []*segment // ascending by id; the last one is the one being appended to
+	current    *os.File
+	currentLen int64
+}
+
+// Open opens, creating if necessary, the spool rooted at dir. maxSegmentBytes
+// bounds the size of a segment file before a new one is rotated in; a value <= 0
+// means unbounded. fsync forces every Append to be flushed to disk before it
+// returns, trading throughput for a tighter durability guarantee.
+func Open(dir string, maxSegmentBytes int64, fsync bool) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("spool: create directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxSegmentBytes: maxSegmentBytes, fsync: fsync}
+
+	ids, err := s.listSegmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		watermark, acked := readCommitted(s.committedPath(id))
+		s.segments = append(s.segments, &segment{id: id, watermark: watermark, acked: acked})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		if err := s.rotateLocked(); err != nil {
+			return nil, err
+		}
+	} else if err := s.openCurrentLocked(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Replay reads every segment on disk and returns the records that have not yet been
+// committed, skipping every record each segment's sidecar marks as already
+// acknowledged, whether below its watermark or committed out of order. It is intended to be called once, right after Open, before any new
+// Append calls are made for the current process, so the caller can re-queue
+// whatever was left pending by a previous, possibly crashed, run.
+func (s *Spool) Replay() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []Record
+	for _, seg := range s.segments {
+		payloads, err := readSegment(s.segmentPath(seg.id))
+		if err != nil {
+			return nil, fmt.Errorf("spool: replay segment %d: %w", seg.id, err)
+		}
+		seg.total = int64(len(payloads))
+
+		for i := seg.watermark; i < seg.total; i++ {
+			if _, ok := seg.acked[i]; ok {
+				continue
+			}
+			records = append(records, Record{ID: RecordID{SegmentID: seg.id, Seq: i}, Payload: payloads[i]})
+		}
+	}
+	return records, nil
+}
+
+// Append writes payload to the current segment, rotating to a new segment first if
+// doing so would exceed maxSegmentBytes, and returns the RecordID needed to later
+// acknowledge it via Commit.
+func (s *Spool) Append(payload []byte) (RecordID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordSize := int64(recordHeaderSize + len(payload))
+	if s.maxSegmentBytes > 0 && s.currentLen > 0 && s.currentLen+recordSize > s.maxSegmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return RecordID{}, err
+		}
+	}
+
+	cur := s.segments[len(s.segments)-1]
+	seq := cur.total
+
+	if err := writeRecord(s.current, payload); err != nil {
+		return RecordID{}, fmt.Errorf("spool: append record: %w", err)
+	}
+	if s.fsync {
+		if err := s.current.Sync(); err != nil {
+			return RecordID{}, fmt.Errorf("spool: fsync segment %d: %w", cur.id, err)
+		}
+	}
+
+	cur.total++
+	s.currentLen += recordSize
+	return RecordID{SegmentID: cur.id, Seq: seq}, nil
+}
+
+// Commit acknowledges ids as durably delivered, persisting each touched segment's
+// committed state so Replay will skip them even across a restart. ids need not
+// arrive in a contiguous, front-of-segment order: an earlier batch can still be
+// outstanding (or have failed) while a later one commits first, so each acked seq is
+// tracked individually and only folded into the skippable watermark once every
+// lower seq has also been committed. Once every record appended to a segment has
+// been committed, the segment is sealed — rotating in a fresh current segment first
+// if it was the one being appended to — and its files are removed from disk.
+func (s *Spool) Commit(ids ...RecordID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seqsBySegment := make(map[int64][]int64)
+	for _, id := range ids {
+		seqsBySegment[id.SegmentID] = append(seqsBySegment[id.SegmentID], id.Seq)
+	}
+
+	for _, seg := range s.segments {
+		seqs, ok := seqsBySegment[seg.id]
+		if !ok {
+			continue
+		}
+		for _, seq := range seqs {
+			if seq < seg.watermark {
+				continue
+			}
+			if seg.acked == nil {
+				seg.acked = make(map[int64]struct{})
+			}
+			seg.acked[seq] = struct{}{}
+		}
+		for {
+			if _, ok := seg.acked[seg.watermark]; !ok {
+				break
+			}
+			delete(seg.acked, seg.watermark)
+			seg.watermark++
+		}
+		if err := writeCommitted(s.committedPath(seg.id), seg.watermark, seg.acked); err != nil {
+			return fmt.Errorf("spool: persist committed offset for segment %d: %w", seg.id, err)
+		}
+	}
+
+	// A fully-committed current segment would otherwise never be removed, growing
+	// unbounded for the lifetime of the process; seal it by rotating in a new one.
+	if cur := s.segments[len(s.segments)-1]; cur.total > 0 && cur.watermark >= cur.total {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	currentID := s.segments[len(s.segments)-1].id
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg.id != currentID && seg.total > 0 && seg.watermark >= seg.total {
+			if err := os.Remove(s.segmentPath(seg.id)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("spool: remove committed segment %d: %w", seg.id, err)
+			}
+			if err := os.Remove(s.committedPath(seg.id)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("spool: remove committed offset marker for segment %d: %w", seg.id, err)
+			}
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+	return nil
+}
+
+// Close closes the current segment file. The spool can be reopened later with
+// Open against the same directory.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return nil
+	}
+	return s.current.Close()
+}
+
+func (s *Spool) segmentPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, id, segmentSuffix))
+}
+
+func (s *Spool) committedPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, id, committedSuffix))
+}
+
+// readCommitted reads the committed state persisted for a segment: the
+// contiguous-from-zero watermark on its own line, followed by a line of
+// comma-separated seqs at or beyond the watermark that were committed out of
+// order. A missing or unparseable sidecar (e.g. one left truncated by a crash
+// mid-write) is treated as nothing committed, which only costs an extra resend on
+// the next restart, consistent with the spool's at-least-once guarantee.
+func readCommitted(path string) (watermark int64, acked map[int64]struct{}) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+	watermark, err = strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	if len(lines) < 2 || strings.TrimSpace(lines[1]) == "" {
+		return watermark, nil
+	}
+	acked = make(map[int64]struct{})
+	for _, field := range strings.Split(strings.TrimSpace(lines[1]), ",") {
+		seq, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		acked[seq] = struct{}{}
+	}
+	return watermark, acked
+}
+
+// writeCommitted durably persists a segment's committed state, writing to a
+// temporary file and renaming it into place so a crash mid-write can't leave a
+// corrupt sidecar behind.
+func writeCommitted(path string, watermark int64, acked map[int64]struct{}) error {
+	seqs := make([]int64, 0, len(acked))
+	for seq := range acked {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	fields := make([]string, len(seqs))
+	for i, seq := range seqs {
+		fields[i] = strconv.FormatInt(seq, 10)
+	}
+
+	content := strconv.FormatInt(watermark, 10) + "\n" + strings.Join(fields, ",")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Spool) listSegmentIDs() ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool: list directory: %w", err)
+	}
+
+	var ids []int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		idStr := strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix)
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// rotateLocked closes the current segment file, if any, and opens a new one with
+// the next sequential id. Callers must hold s.mu.
+func (s *Spool) rotateLocked() error {
+	if s.current != nil {
+		if err := s.current.Close(); err != nil {
+			return fmt.Errorf("spool: close segment: %w", err)
+		}
+	}
+
+	nextID := int64(1)
+	if len(s.segments) > 0 {
+		nextID = s.segments[len(s.segments)-1].id + 1
+	}
+	s.segments = append(s.segments, &segment{id: nextID})
+
+	f, err := os.OpenFile(s.segmentPath(nextID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("spool: create segment %d: %w", nextID, err)
+	}
+	s.current = f
+	s.currentLen = 0
+	return nil
+}
+
+// openCurrentLocked reopens the most recent segment file for appending, resuming
+// from where a previous process left off. Callers must hold s.mu.
+func (s *Spool) openCurrentLocked() error {
+	cur := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.segmentPath(cur.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("spool: open segment %d: %w", cur.id, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("spool: stat segment %d: %w", cur.id, err)
+	}
+	s.current = f
+	s.currentLen = info.Size()
+	return nil
+}
+
+func writeRecord(w io.Writer, payload []byte) error {
+	header := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readSegment reads every well-formed record from the segment file at path, in
+// append order. A record whose header or payload was only partially written (the
+// signature of a crash mid-append) is detected by a short read or a CRC mismatch;
+// reading stops there rather than risk misinterpreting the rest of the file.
+// A segment file that does not exist yet is treated as empty.
+func readSegment(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var payloads [][]byte
+	r := bufio.NewReader(f)
+	for {
+		header := make([]byte, recordHeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		wantCRC := binary.BigEndian.Uint32(header[4:8])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != wantCRC {
+			break
+		}
+
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2020, OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool_appendAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	var ids []RecordID
+	for i := 0; i < 100; i++ {
+		id, err := s.Append([]byte(fmt.Sprintf("payload-%d", i)))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, s.Close())
+
+	reopened, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	records, err := reopened.Replay()
+	require.NoError(t, err)
+	assert.Equal(t, 100, len(records))
+	for i, rec := range records {
+		assert.Equal(t, fmt.Sprintf("payload-%d", i), string(rec.Payload))
+		assert.Equal(t, ids[i], rec.ID)
+	}
+}
+
+func TestSpool_commitRemovesSealedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	// Small maxSegmentBytes forces frequent rotation so we exercise multiple
+	// segment files.
+	s, err := Open(dir, 64, false)
+	require.NoError(t, err)
+
+	var ids []RecordID
+	for i := 0; i < 20; i++ {
+		id, err := s.Append([]byte(fmt.Sprintf("event-%02d", i)))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	entriesBefore, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Greater(t, len(entriesBefore), 1, "expected rotation to create more than one segment")
+
+	// Commit everything except the most recent record, which should still live
+	// in the (uncommitted, and possibly still-current) last segment.
+	require.NoError(t, s.Commit(ids[:len(ids)-1]...))
+
+	entriesAfter, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Less(t, len(entriesAfter), len(entriesBefore), "fully committed segments should have been removed")
+
+	require.NoError(t, s.Commit(ids[len(ids)-1]))
+}
+
+func TestSpool_replaySkipsOnlyCommittedRecords(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	var ids []RecordID
+	for i := 0; i < 4; i++ {
+		id, err := s.Append([]byte(fmt.Sprintf("event-%d", i)))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, s.Commit(ids[:2]...))
+	require.NoError(t, s.Close())
+
+	reopened, err := Open(dir, 0, false)
+	require.NoError(t, err)
+	records, err := reopened.Replay()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, "event-2", string(records[0].Payload))
+	assert.Equal(t, "event-3", string(records[1].Payload))
+}
+
+// TestSpool_commitedEventsNeverResentAfterRestart guards against a spool that
+// resends already-acknowledged events forever: with the default unbounded
+// maxSegmentBytes (a single, always-current segment), Commit must still persist
+// enough state that a fully-committed segment is both excluded from Replay and
+// eventually removed from disk.
+func TestSpool_commitedEventsNeverResentAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	var ids []RecordID
+	for i := 0; i < 5; i++ {
+		id, err := s.Append([]byte(fmt.Sprintf("event-%d", i)))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, s.Commit(ids...))
+	require.NoError(t, s.Close())
+
+	reopened, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	records, err := reopened.Replay()
+	require.NoError(t, err)
+	assert.Empty(t, records, "fully committed records must not be replayed after a restart")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.NotEqual(t, "segment-00000000000000000001.wal", e.Name(), "the fully committed segment should have been sealed and removed, not kept around forever")
+	}
+}
+
+// TestSpool_outOfOrderCommitDoesNotLoseEarlierRecord guards against a spool that
+// acknowledges by leading-record count instead of by identity: if a later record
+// commits while an earlier one in the same segment is still outstanding (e.g. its
+// batch failed to send), the earlier record must still be replayed after a
+// restart, and must not be mistaken for committed just because a later one was.
+func TestSpool_outOfOrderCommitDoesNotLoseEarlierRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0, false)
+	require.NoError(t, err)
+
+	failedID, err := s.Append([]byte("FAILED-e0"))
+	require.NoError(t, err)
+	okID, err := s.Append([]byte("OK-e1"))
+	require.NoError(t, err)
+
+	// Only the later record's batch is committed; failedID's send failed and is
+	// never acknowledged.
+	require.NoError(t, s.Commit(okID))
+	require.NoError(t, s.Close())
+
+	reopened, err := Open(dir, 0, false)
+	require.NoError(t, err)
+	records, err := reopened.Replay()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(records), "the still-outstanding earlier record must be replayed, not lost")
+	assert.Equal(t, failedID, records[0].ID)
+	assert.Equal(t, "FAILED-e0", string(records[0].Payload))
+
+	require.NoError(t, reopened.Commit(failedID))
+	require.NoError(t, reopened.Close())
+
+	final, err := Open(dir, 0, false)
+	require.NoError(t, err)
+	records, err = final.Replay()
+	require.NoError(t, err)
+	assert.Empty(t, records, "once the earlier record is also committed, nothing should remain to replay")
+}
+
+func TestSpool_replaySkipsCorruptTrailingRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 0, false)
+	require.NoError(t, err)
+	_, err = s.Append([]byte("good record"))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Simulate a crash mid-write: append a truncated, bogus record to the
+	// segment file directly.
+	matches, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(matches))
+
+	f, err := os.OpenFile(matches[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 10, 1, 2, 3, 4, 'x', 'y'})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := Open(dir, 0, false)
+	require.NoError(t, err)
+	records, err := reopened.Replay()
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "good record", string(records[0].Payload))
+}